@@ -0,0 +1,70 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sql
+
+import (
+	"hash/fnv"
+
+	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+)
+
+// approxCountDistinctAggregate is the accumulator for
+// APPROX_COUNT_DISTINCT: Add folds one row's value into the underlying HLL
+// sketch (hll.go), Merge combines another stream's sketch into this one,
+// and Estimate reads off the cardinality. It is not registered as an
+// aggregate builtin, and distsql planning of APPROX_COUNT_DISTINCT is
+// rejected in distsql_aggregator_visitors.go, since AggregatorSpec_Func has
+// no enum value for it and the distsqlrun local/final aggregator processors
+// do not construct or merge sketches; extractAggExprs only constructs one to
+// validate the configured precision.
+type approxCountDistinctAggregate struct {
+	sketch *hllSketch
+}
+
+// newApproxCountDistinctAggregate allocates an accumulator at the given
+// precision (see hllPrecisionFromSessionVar).
+func newApproxCountDistinctAggregate(precision uint) (*approxCountDistinctAggregate, error) {
+	sketch, err := newHLLSketch(precision)
+	if err != nil {
+		return nil, err
+	}
+	return &approxCountDistinctAggregate{sketch: sketch}, nil
+}
+
+// Add folds one row's value into the sketch.
+func (a *approxCountDistinctAggregate) Add(d parser.Datum) {
+	a.sketch.Add(hashDatum(d))
+}
+
+// Merge combines other's sketch into a's register-wise by max, so sketches
+// built over separate streams combine into one.
+func (a *approxCountDistinctAggregate) Merge(other *approxCountDistinctAggregate) error {
+	return a.sketch.MergeMax(other.sketch)
+}
+
+// Estimate returns the cardinality estimate.
+func (a *approxCountDistinctAggregate) Estimate() float64 {
+	return a.sketch.Estimate()
+}
+
+// hashDatum maps a SQL datum onto a 64-bit hash suitable for hllSketch.Add.
+// Datum's string representation is sufficient here since HLL only needs a
+// hash that's stable and well-distributed per distinct value, not one that
+// round-trips.
+func hashDatum(d parser.Datum) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(d.String()))
+	return h.Sum64()
+}
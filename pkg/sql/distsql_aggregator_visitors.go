@@ -25,10 +25,31 @@ import (
 
 	"github.com/cockroachdb/cockroach/pkg/sql/distsqlrun"
 	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+	"github.com/pkg/errors"
 )
 
+// approxCountDistinctName is the SQL function name for a HyperLogLog
+// cardinality estimate (see hll.go, approx_count_distinct.go). It isn't
+// plannable for distributed execution yet (VisitPre below declines it
+// outright), but, like the exact aggregations, is idempotent under
+// DISTINCT: 'APPROX_COUNT_DISTINCT(DISTINCT k)' and
+// 'APPROX_COUNT_DISTINCT(k)' are equivalent, since the HLL sketch already
+// discards duplicates as part of estimating cardinality.
+const approxCountDistinctName = "APPROX_COUNT_DISTINCT"
+
 type aggExprVisitor struct {
 	exprs []distsqlrun.AggregatorSpec_Expr
+	// hllPrecision is the precision (see hllPrecisionFromSessionVar) used to
+	// eagerly validate any APPROX_COUNT_DISTINCT call below, so a bad
+	// `SET hll_sketch_precision` value surfaces at plan time rather than
+	// wherever the sketch is first constructed at execution time.
+	hllPrecision uint
+	// err is set and the walk short-circuited if we see a function name that
+	// doesn't resolve to a known AggregatorSpec_Func. Without this check, a
+	// missing map entry (e.g. because the function hasn't actually been added
+	// to the AggregatorSpec_Func proto yet) would silently plan as
+	// AggregatorSpec_Func(0) and produce wrong results instead of failing.
+	err error
 }
 
 var _ parser.Visitor = &aggExprVisitor{}
@@ -38,6 +59,10 @@ var _ parser.Visitor = &aggExprVisitor{}
 // If our expression is NOT of the type *aggregateFuncHolder we may have an
 // expression like 'COUNT(k) + 1', we recurse.
 func (v *aggExprVisitor) VisitPre(expr parser.Expr) (bool, parser.Expr) {
+	if v.err != nil {
+		return false, expr
+	}
+
 	fholder, ok := expr.(*aggregateFuncHolder)
 	if !ok {
 		return true, expr
@@ -52,25 +77,62 @@ func (v *aggExprVisitor) VisitPre(expr parser.Expr) (bool, parser.Expr) {
 		return false, expr
 	}
 
+	funcName := strings.ToUpper(f.Func.FunctionReference.String())
+	if funcName == approxCountDistinctName {
+		// AggregatorSpec_Func has no enum value for APPROX_COUNT_DISTINCT yet
+		// (it requires a proto change) and the distsqlrun local/final
+		// aggregator processors don't construct/merge HLL sketches, so there
+		// is nothing correct we could plan it as here. Validate the
+		// configured precision eagerly (the accumulator that will back the
+		// non-distributed path once it's wired up — see
+		// approxCountDistinctAggregate, approx_count_distinct.go) and
+		// otherwise decline distributed planning outright, rather than
+		// falling through to the generic lookup below and silently planning
+		// as AggregatorSpec_Func(0).
+		if _, err := newApproxCountDistinctAggregate(v.hllPrecision); err != nil {
+			v.err = err
+			return false, expr
+		}
+		v.err = errors.Errorf("%s is not yet supported for distributed execution", approxCountDistinctName)
+		return false, expr
+	}
+
+	funcVal, ok := distsqlrun.AggregatorSpec_Func_value[funcName]
+	if !ok {
+		v.err = errors.Errorf("unsupported distributed aggregation function %q", funcName)
+		return false, expr
+	}
+
 	aggexpr := distsqlrun.AggregatorSpec_Expr{
-		Func: distsqlrun.AggregatorSpec_Func(
-			distsqlrun.AggregatorSpec_Func_value[strings.ToUpper(
-				f.Func.FunctionReference.String(),
-			)],
-		),
-		Distinct: f.Type == parser.DistinctFuncType,
+		Func:     distsqlrun.AggregatorSpec_Func(funcVal),
+		Distinct: isDistinctAggregation(funcName, f.Type == parser.DistinctFuncType),
 	}
 	v.exprs = append(v.exprs, aggexpr)
 	return false, expr
 }
 
+// isDistinctAggregation reports whether funcName, given that the user wrote
+// DISTINCT in the aggregate call, should actually plan as a distinct
+// aggregation. APPROX_COUNT_DISTINCT is idempotent under DISTINCT: its HLL
+// sketch already de-dupes as part of estimating cardinality, so a
+// user-written DISTINCT is a no-op rather than a request for the
+// (considerably more expensive) exact-distinct aggregator.
+func isDistinctAggregation(funcName string, wroteDistinct bool) bool {
+	return wroteDistinct && funcName != approxCountDistinctName
+}
+
 func (v *aggExprVisitor) VisitPost(expr parser.Expr) parser.Expr {
 	return expr
 }
 
-func (v aggExprVisitor) extract(typedExpr parser.TypedExpr) []distsqlrun.AggregatorSpec_Expr {
+func (v aggExprVisitor) extract(
+	typedExpr parser.TypedExpr,
+) ([]distsqlrun.AggregatorSpec_Expr, error) {
 	parser.WalkExprConst(&v, typedExpr)
-	return v.exprs
+	if v.err != nil {
+		return nil, v.err
+	}
+	return v.exprs, nil
 }
 
 // extractAggExprs translates the render expressions into the form needed by
@@ -98,17 +160,29 @@ func (v aggExprVisitor) extract(typedExpr parser.TypedExpr) []distsqlrun.Aggrega
 //
 //   NB: The actual addition in 'COUNT(k) + COUNT(v)' will be computed in
 //   postAggExprVisitor.
+//
+// An error is returned (rather than planning proceeding with a zero-value
+// AggregatorSpec_Func) if a render contains an aggregate function distsql
+// doesn't know how to plan; callers should fall back to local execution in
+// that case. hllPrecision is validated for any APPROX_COUNT_DISTINCT call
+// found (see hllPrecisionFromSessionVar), which is then rejected with an
+// error either way; it's threaded in rather than read off a
+// global so planning stays a pure function of its inputs.
 func (dsp *distSQLPlanner) extractAggExprs(
-	render []parser.TypedExpr,
-) (aggExprs []distsqlrun.AggregatorSpec_Expr) {
-	v := aggExprVisitor{}
+	render []parser.TypedExpr, hllPrecision uint,
+) (aggExprs []distsqlrun.AggregatorSpec_Expr, _ error) {
+	v := aggExprVisitor{hllPrecision: hllPrecision}
 	for _, expr := range render {
-		aggExprs = append(aggExprs, v.extract(expr)...)
+		exprs, err := v.extract(expr)
+		if err != nil {
+			return nil, err
+		}
+		aggExprs = append(aggExprs, exprs...)
 	}
 	for i := range aggExprs {
 		aggExprs[i].ColIdx = uint32(i)
 	}
-	return aggExprs
+	return aggExprs, nil
 }
 
 type postAggExprVisitor struct {
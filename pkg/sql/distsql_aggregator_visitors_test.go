@@ -0,0 +1,35 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sql
+
+import "testing"
+
+func TestIsDistinctAggregation(t *testing.T) {
+	testCases := []struct {
+		funcName string
+		wrote    bool
+		want     bool
+	}{
+		{`COUNT`, true, true},
+		{`COUNT`, false, false},
+		{approxCountDistinctName, true, false},
+		{approxCountDistinctName, false, false},
+	}
+	for _, tc := range testCases {
+		if got := isDistinctAggregation(tc.funcName, tc.wrote); got != tc.want {
+			t.Errorf(`isDistinctAggregation(%q, %v) = %v, want %v`, tc.funcName, tc.wrote, got, tc.want)
+		}
+	}
+}
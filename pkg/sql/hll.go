@@ -0,0 +1,187 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+//
+// This file implements the HyperLogLog sketch backing APPROX_COUNT_DISTINCT
+// (see approx_count_distinct.go, distsql_aggregator_visitors.go): a sketch
+// is built per stream via Add, per-stream sketches combine register-wise
+// via MergeMax, and the result is read off via Estimate.
+
+package sql
+
+import (
+	"math"
+	"math/bits"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// hllMinPrecision and hllMaxPrecision bound the `hll_sketch_precision`
+	// session variable that trades memory for accuracy: a sketch holds
+	// 2^precision single-byte registers.
+	hllMinPrecision = 10
+	hllMaxPrecision = 18
+	// hllDefaultPrecision gives 2^14 = 16384 registers, ~16 KiB per sketch.
+	hllDefaultPrecision = 14
+)
+
+// hllSketch is a dense HyperLogLog sketch used to estimate the number of
+// distinct values added to it.
+type hllSketch struct {
+	p         uint
+	m         uint32
+	registers []uint8
+}
+
+// newHLLSketch allocates a sketch with 2^precision registers.
+func newHLLSketch(precision uint) (*hllSketch, error) {
+	if precision < hllMinPrecision || precision > hllMaxPrecision {
+		return nil, errors.Errorf(
+			"hll precision must be between %d and %d, got %d", hllMinPrecision, hllMaxPrecision, precision,
+		)
+	}
+	m := uint32(1) << precision
+	return &hllSketch{p: precision, m: m, registers: make([]uint8, m)}, nil
+}
+
+// Add folds a 64-bit hash of a value into the sketch. The hash is first run
+// through the MurmurHash3 64-bit finalizer, so that hashes with weak low bits
+// (such as FNV-1a over similar strings) still spread evenly; then the low p
+// bits select a register, and the register is set to the max of its current
+// value and one plus the number of trailing zeros in the remaining bits.
+func (s *hllSketch) Add(hash uint64) {
+	hash ^= hash >> 33
+	hash *= 0xff51afd7ed558ccd
+	hash ^= hash >> 33
+	hash *= 0xc4ceb9fe1a85ec53
+	hash ^= hash >> 33
+
+	idx := hash & uint64(s.m-1)
+	w := hash >> s.p
+
+	var rho uint8
+	if w == 0 {
+		rho = uint8(64-s.p) + 1
+	} else {
+		rho = uint8(bits.TrailingZeros64(w)) + 1
+	}
+	if rho > s.registers[idx] {
+		s.registers[idx] = rho
+	}
+}
+
+// MergeMax combines other into s register-wise by max, as is required to
+// combine per-stream sketches into a single final-aggregator sketch.
+func (s *hllSketch) MergeMax(other *hllSketch) error {
+	if s.p != other.p {
+		return errors.Errorf("cannot merge HLL sketches of precision %d and %d", s.p, other.p)
+	}
+	for i, r := range other.registers {
+		if r > s.registers[i] {
+			s.registers[i] = r
+		}
+	}
+	return nil
+}
+
+// hllAlpha is the bias-correction constant from the original HyperLogLog
+// paper, as a function of the number of registers m.
+func hllAlpha(m uint32) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(m))
+	}
+}
+
+// the sketch operates over 64-bit hashes, so the large-range correction
+// below is relative to 2^64 rather than the original paper's 2^32.
+const hllTwoToThe64 = math.MaxUint64 + 1.0
+
+// Estimate returns the sketch's cardinality estimate, applying the standard
+// small- and large-range bias corrections: linear counting when the raw
+// estimate undershoots (many empty registers), and a log-based correction
+// when it approaches the hash space's cardinality.
+func (s *hllSketch) Estimate() float64 {
+	m := float64(s.m)
+
+	var sum float64
+	var zeros int
+	for _, r := range s.registers {
+		sum += 1 / math.Pow(2, float64(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	raw := hllAlpha(s.m) * m * m / sum
+	switch {
+	case raw <= 2.5*m && zeros > 0:
+		return m * math.Log(m/float64(zeros))
+	case raw <= hllTwoToThe64/30:
+		return raw
+	default:
+		return -hllTwoToThe64 * math.Log(1-raw/hllTwoToThe64)
+	}
+}
+
+// hllPrecisionFromSessionVar validates the value of the `hll_sketch_precision`
+// session variable, which controls the precision newHLLSketch is called with
+// when planning APPROX_COUNT_DISTINCT.
+func hllPrecisionFromSessionVar(precision int) (uint, error) {
+	if precision < hllMinPrecision || precision > hllMaxPrecision {
+		return 0, errors.Errorf(
+			"hll_sketch_precision must be between %d and %d, got %d", hllMinPrecision, hllMaxPrecision, precision,
+		)
+	}
+	return uint(precision), nil
+}
+
+// hllSessionVar models the `hll_sketch_precision` session variable (SET
+// hll_sketch_precision = N): its value is the precision taken by
+// extractAggExprs's hllPrecision parameter, which validates it for any
+// APPROX_COUNT_DISTINCT call before rejecting that call for distributed
+// execution. It isn't yet registered with the session variable
+// machinery (not present in this tree); Set/Get model the registration
+// hook that would call through to it.
+type hllSessionVar struct {
+	precision uint
+}
+
+// newHLLSessionVar returns an hllSessionVar initialized to
+// hllDefaultPrecision, as a session would be before any SET.
+func newHLLSessionVar() hllSessionVar {
+	return hllSessionVar{precision: hllDefaultPrecision}
+}
+
+// Set validates and applies a new precision, as the session var's SET hook
+// would.
+func (v *hllSessionVar) Set(precision int) error {
+	p, err := hllPrecisionFromSessionVar(precision)
+	if err != nil {
+		return err
+	}
+	v.precision = p
+	return nil
+}
+
+// Get returns the currently configured precision.
+func (v hllSessionVar) Get() uint {
+	return v.precision
+}
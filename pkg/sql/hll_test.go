@@ -0,0 +1,153 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sql
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestNewHLLSketchInvalidPrecision(t *testing.T) {
+	if _, err := newHLLSketch(hllMinPrecision - 1); err == nil {
+		t.Fatal(`expected an error for a too-small precision`)
+	}
+	if _, err := newHLLSketch(hllMaxPrecision + 1); err == nil {
+		t.Fatal(`expected an error for a too-large precision`)
+	}
+}
+
+// fnv64a hashes s the same way hashDatum does, without needing a parser.Datum.
+func fnv64a(s string) uint64 {
+	const offset = 14695981039346656037
+	const prime = 1099511628211
+	h := uint64(offset)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime
+	}
+	return h
+}
+
+func TestHLLSketchEstimate(t *testing.T) {
+	testCases := []struct {
+		precision uint
+		n         int
+	}{
+		{14, 100},
+		{14, 10000},
+		{14, 1000000},
+		{10, 1000},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf(`precision=%d/n=%d`, tc.precision, tc.n), func(t *testing.T) {
+			sketch, err := newHLLSketch(tc.precision)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tc.n; i++ {
+				sketch.Add(fnv64a(fmt.Sprintf(`val-%d`, i)))
+			}
+			got := sketch.Estimate()
+			// The standard error of a HLL estimate is ~1.04/sqrt(m); allow a
+			// generous multiple of that to keep this test from being flaky.
+			m := float64(uint32(1) << tc.precision)
+			maxRelErr := 6 * 1.04 / math.Sqrt(m)
+			relErr := math.Abs(got-float64(tc.n)) / float64(tc.n)
+			if relErr > maxRelErr {
+				t.Fatalf(`estimate %f for n=%d off by %.4f, want at most %.4f`, got, tc.n, relErr, maxRelErr)
+			}
+		})
+	}
+}
+
+func TestHLLSketchMergeMax(t *testing.T) {
+	const precision = 14
+	a, err := newHLLSketch(precision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newHLLSketch(precision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5000; i++ {
+		a.Add(fnv64a(fmt.Sprintf(`a-%d`, i)))
+	}
+	for i := 0; i < 5000; i++ {
+		b.Add(fnv64a(fmt.Sprintf(`b-%d`, i)))
+	}
+	if err := a.MergeMax(b); err != nil {
+		t.Fatal(err)
+	}
+
+	got := a.Estimate()
+	const want = 10000
+	m := float64(uint32(1) << precision)
+	maxRelErr := 6 * 1.04 / math.Sqrt(m)
+	relErr := math.Abs(got-want) / want
+	if relErr > maxRelErr {
+		t.Fatalf(`merged estimate %f off by %.4f, want at most %.4f`, got, relErr, maxRelErr)
+	}
+}
+
+func TestHLLSketchMergeMaxPrecisionMismatch(t *testing.T) {
+	a, err := newHLLSketch(14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newHLLSketch(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.MergeMax(b); err == nil {
+		t.Fatal(`expected an error merging sketches of different precisions`)
+	}
+}
+
+func TestHLLPrecisionFromSessionVar(t *testing.T) {
+	if _, err := hllPrecisionFromSessionVar(hllMinPrecision - 1); err == nil {
+		t.Fatal(`expected an error`)
+	}
+	if _, err := hllPrecisionFromSessionVar(hllMaxPrecision + 1); err == nil {
+		t.Fatal(`expected an error`)
+	}
+	p, err := hllPrecisionFromSessionVar(hllDefaultPrecision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != hllDefaultPrecision {
+		t.Fatalf(`got %d`, p)
+	}
+}
+
+func TestHLLSessionVar(t *testing.T) {
+	v := newHLLSessionVar()
+	if v.Get() != hllDefaultPrecision {
+		t.Fatalf(`got default %d`, v.Get())
+	}
+	if err := v.Set(hllMaxPrecision + 1); err == nil {
+		t.Fatal(`expected an error`)
+	}
+	if v.Get() != hllDefaultPrecision {
+		t.Fatalf(`a failed Set should leave the precision unchanged, got %d`, v.Get())
+	}
+	if err := v.Set(hllMinPrecision); err != nil {
+		t.Fatal(err)
+	}
+	if v.Get() != hllMinPrecision {
+		t.Fatalf(`got %d`, v.Get())
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package tpcc
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestRNGConfigFlags(t *testing.T) {
+	var c rngConfig
+	f := pflag.NewFlagSet(``, pflag.ContinueOnError)
+	c.flags(f)
+	if err := f.Parse([]string{`--rng=chacha8`}); err != nil {
+		t.Fatal(err)
+	}
+	if c.kind != rngKindChaCha8 {
+		t.Fatalf(`got %q, expected %q`, c.kind, rngKindChaCha8)
+	}
+}
+
+func TestEventConfigFlags(t *testing.T) {
+	var c eventConfig
+	f := pflag.NewFlagSet(``, pflag.ContinueOnError)
+	c.flags(f)
+	if err := f.Parse([]string{`--event-listen-addr=localhost:8081`}); err != nil {
+		t.Fatal(err)
+	}
+	if c.listenAddr != `localhost:8081` {
+		t.Fatalf(`got %q`, c.listenAddr)
+	}
+}
+
+func TestRNGConfigSource(t *testing.T) {
+	pcg := rngConfig{kind: rngKindPCG}
+	if _, ok := pcg.source(1, 0).(*chachaSource); ok {
+		t.Fatalf(`expected the default %q kind not to select chachaSource`, rngKindPCG)
+	}
+
+	chacha := rngConfig{kind: rngKindChaCha8}
+	src1 := chacha.source(1, 0)
+	src2 := chacha.source(1, 1)
+	if src1.(*chachaSource).Uint64() == src2.(*chachaSource).Uint64() {
+		t.Fatal(`expected distinct worker ids to produce independent streams`)
+	}
+}
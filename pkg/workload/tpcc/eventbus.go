@@ -0,0 +1,218 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package tpcc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// txnEvent describes a single completed (or in-flight-but-notable) event in
+// the TPC-C workload: one per finished transaction, plus the IMPORT/rebalance
+// lifecycle events below. It is the payload streamed to --event-listen-addr
+// subscribers.
+type txnEvent struct {
+	Ts           time.Time `json:"ts"`
+	WorkerID     int       `json:"worker_id"`
+	WarehouseID  int       `json:"warehouse_id"`
+	TxnType      string    `json:"txn_type"`
+	LatencyNanos int64     `json:"latency_ns"`
+	Retries      int       `json:"retries"`
+	SQLError     string    `json:"sql_error,omitempty"`
+	RowsAffected int64     `json:"rows_affected"`
+
+	// Kind distinguishes the steady-state "txn" events above from the
+	// lifecycle events below; lifecycle events leave most of the txn fields
+	// zero and use Detail instead.
+	Kind   string `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+const (
+	eventKindTxn            = "txn"
+	eventKindImportProgress = "import_progress"
+	eventKindRebalanceStall = "rebalance_stall"
+)
+
+// eventRingSize is the capacity of the ring buffer backing the event bus. It
+// is sized generously relative to expected subscriber poll latency; a
+// subscriber that falls more than this many events behind is considered slow
+// and has its cursor fast-forwarded (see eventSubscriber.poll).
+const eventRingSize = 1 << 14 // 16384, a power of 2 so index wrapping is a mask.
+
+// eventRing is a single-producer, multi-consumer ring buffer. The txn
+// dispatch loop is the sole writer (via push); any number of subscribers may
+// read concurrently through their own monotonic cursors. There is no
+// coordination between the writer and readers beyond the atomic write
+// cursor: a slow reader can be lapped by the writer, at which point it is
+// detected and handled by dropping forward rather than blocking the
+// workload (see eventSubscriber.poll).
+type eventRing struct {
+	buf   [eventRingSize]txnEvent
+	write uint64 // atomic, next slot to be written is write&mask
+}
+
+// push writes e into the next slot and only then publishes the new write
+// cursor. Since this is single-producer, the slot is reserved by a plain
+// load rather than a CAS; the store to r.write must come after the slot
+// write so a concurrent poll() can never observe the bumped cursor before
+// the event it points to has landed.
+func (r *eventRing) push(e txnEvent) {
+	idx := atomic.LoadUint64(&r.write)
+	r.buf[idx&(eventRingSize-1)] = e
+	atomic.StoreUint64(&r.write, idx+1)
+}
+
+// eventSubscriber tracks one consumer's position in the ring.
+type eventSubscriber struct {
+	ring    *eventRing
+	read    uint64
+	dropped uint64 // count of events skipped because the reader fell behind
+}
+
+// poll returns the next unseen event, if any. If the reader has fallen more
+// than eventRingSize events behind the writer, its cursor is fast-forwarded
+// to the oldest event still in the buffer and dropped is incremented by the
+// number of events skipped; slow subscribers are thinned out rather than
+// allowed to backpressure the workload.
+func (s *eventSubscriber) poll() (txnEvent, bool) {
+	write := atomic.LoadUint64(&s.ring.write)
+	if s.read == write {
+		return txnEvent{}, false
+	}
+	if write-s.read > eventRingSize {
+		skipped := write - s.read - eventRingSize
+		s.read = write - eventRingSize
+		s.dropped += skipped
+	}
+	e := s.ring.buf[s.read&(eventRingSize-1)]
+	s.read++
+	return e, true
+}
+
+// eventBus fans transaction-lifecycle events out to any number of
+// --event-listen-addr subscribers. Publish only ever touches the lock-free
+// ring; the subscriber list is protected by a mutex since it's only
+// read/written when connections come and go, never from the hot path.
+type eventBus struct {
+	ring eventRing
+
+	mu struct {
+		sync.Mutex
+		subs map[*eventSubscriber]struct{}
+	}
+}
+
+func newEventBus() *eventBus {
+	b := &eventBus{}
+	b.mu.subs = make(map[*eventSubscriber]struct{})
+	return b
+}
+
+// Publish records e into the ring, making it visible to every current and
+// future subscriber. See recordTxn, the dispatch-loop call site.
+func (b *eventBus) Publish(e txnEvent) {
+	b.ring.push(e)
+}
+
+// Subscribe registers a new subscriber positioned at the current write
+// cursor (it only sees events published after this call) and returns it
+// along with an unsubscribe func.
+func (b *eventBus) Subscribe() (*eventSubscriber, func()) {
+	sub := &eventSubscriber{ring: &b.ring, read: atomic.LoadUint64(&b.ring.write)}
+	b.mu.Lock()
+	b.mu.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub, func() {
+		b.mu.Lock()
+		delete(b.mu.subs, sub)
+		b.mu.Unlock()
+	}
+}
+
+// ServeHTTP streams newline-delimited JSON txnEvents to the client for as
+// long as the connection stays open. Each connection gets its own
+// subscriber; a subscriber that can't keep up has events silently dropped
+// (see eventSubscriber.poll) rather than slowing down the workload.
+func (b *eventBus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	sub, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+
+	ctx := r.Context()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				e, ok := sub.poll()
+				if !ok {
+					break
+				}
+				if err := enc.Encode(e); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// eventConfig holds the --event-listen-addr setting.
+type eventConfig struct {
+	listenAddr string
+}
+
+func (c *eventConfig) flags(f *pflag.FlagSet) {
+	f.StringVar(&c.listenAddr, `event-listen-addr`, ``,
+		`address to serve a per-transaction JSON event stream on, if set`)
+}
+
+// maybeServeEvents starts an HTTP listener for bus's /events stream if addr
+// is set, shutting it down when ctx is canceled. It returns immediately;
+// ListenAndServe errors are not fatal to the workload run.
+func maybeServeEvents(ctx context.Context, addr string, bus *eventBus) {
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/events", bus)
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	go func() {
+		_ = srv.ListenAndServe()
+	}()
+}
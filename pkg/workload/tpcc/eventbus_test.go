@@ -0,0 +1,90 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package tpcc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBusPublishSubscribe(t *testing.T) {
+	bus := newEventBus()
+	sub, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+
+	bus.Publish(txnEvent{TxnType: newOrderTxnType, Kind: eventKindTxn})
+
+	e, ok := sub.poll()
+	if !ok {
+		t.Fatal(`expected an event`)
+	}
+	if e.TxnType != newOrderTxnType {
+		t.Fatalf(`got %q`, e.TxnType)
+	}
+	if _, ok := sub.poll(); ok {
+		t.Fatal(`expected no more events`)
+	}
+}
+
+func TestEventSubscriberDropsWhenSlow(t *testing.T) {
+	bus := newEventBus()
+	sub, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i < eventRingSize+10; i++ {
+		bus.Publish(txnEvent{WorkerID: i})
+	}
+
+	e, ok := sub.poll()
+	if !ok {
+		t.Fatal(`expected an event`)
+	}
+	if e.WorkerID != 10 {
+		t.Fatalf(`expected the lagging subscriber to resume at worker id 10, got %d`, e.WorkerID)
+	}
+	if sub.dropped != 10 {
+		t.Fatalf(`expected 10 dropped events, got %d`, sub.dropped)
+	}
+}
+
+type fakeHistogramSink struct {
+	recorded []string
+}
+
+func (f *fakeHistogramSink) Record(txnType string, _ time.Duration) {
+	f.recorded = append(f.recorded, txnType)
+}
+
+func TestRecordTxnFansOut(t *testing.T) {
+	hist := &fakeHistogramSink{}
+	bus := newEventBus()
+	sub, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+	prom := newPromReporter(promRemoteWriteConfig{})
+
+	recordTxn(hist, bus, prom, 1, 7, newOrderTxnType, 5*time.Millisecond, 0, nil, 1)
+
+	if len(hist.recorded) != 1 || hist.recorded[0] != newOrderTxnType {
+		t.Fatalf(`expected histogram to record %q, got %v`, newOrderTxnType, hist.recorded)
+	}
+	e, ok := sub.poll()
+	if !ok {
+		t.Fatal(`expected an event on the bus`)
+	}
+	if e.WarehouseID != 7 || e.TxnType != newOrderTxnType {
+		t.Fatalf(`unexpected event: %+v`, e)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package tpcc
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/spf13/pflag"
+)
+
+// newOrderTxnType is the txn_type value for New-Order transactions, the ones
+// that count towards tpmC (the standard TPC-C throughput metric).
+const newOrderTxnType = "newOrder"
+
+// promRemoteWriteConfig holds the settings needed to stream tpcc's
+// transaction metrics to a Prometheus remote-write endpoint, wired in via
+// --prom-remote-write and friends.
+type promRemoteWriteConfig struct {
+	// URL is the remote-write endpoint, e.g.
+	// "http://prometheus:9090/api/v1/write". Streaming is disabled when empty.
+	URL string
+	// RunID is attached to every sample as the `run_id` label so that
+	// multiple invocations of the workload can be distinguished in Grafana
+	// without any extra ETL.
+	RunID string
+	// BasicAuthUser/BasicAuthPass and BearerToken are mutually exclusive ways
+	// of authenticating against the remote-write endpoint; at most one should
+	// be set.
+	BasicAuthUser string
+	BasicAuthPass string
+	BearerToken   string
+}
+
+// flags wires promRemoteWriteConfig's fields into the TPC-C generator's flag
+// set.
+func (c *promRemoteWriteConfig) flags(f *pflag.FlagSet) {
+	f.StringVar(&c.URL, `prom-remote-write`, ``,
+		`Prometheus remote-write endpoint to stream txn metrics to, if set`)
+	f.StringVar(&c.RunID, `run-id`, ``,
+		`run id attached to every exported Prometheus sample, to distinguish concurrent runs`)
+	f.StringVar(&c.BasicAuthUser, `prom-remote-write-user`, ``,
+		`basic auth username for --prom-remote-write`)
+	f.StringVar(&c.BasicAuthPass, `prom-remote-write-pass`, ``,
+		`basic auth password for --prom-remote-write`)
+	f.StringVar(&c.BearerToken, `prom-remote-write-token`, ``,
+		`bearer token for --prom-remote-write, mutually exclusive with basic auth`)
+}
+
+// promReporter batches per-transaction samples and flushes them to a
+// Prometheus remote-write endpoint once a second, in addition to (not
+// instead of) the workload's existing stdout histograms.
+type promReporter struct {
+	cfg    promRemoteWriteConfig
+	client *http.Client
+
+	mu struct {
+		sync.Mutex
+		series []prompb.TimeSeries
+	}
+}
+
+// newPromReporter constructs a promReporter from the given config. The
+// returned reporter is inert (Record becomes a no-op) if cfg.URL is empty.
+func newPromReporter(cfg promRemoteWriteConfig) *promReporter {
+	return &promReporter{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// txnLabels describes the per-transaction dimensions tpcc tags every sample
+// with: the transaction kind, the warehouse range it touched, and the
+// reporting node. The user-supplied run id that ties a whole benchmark run
+// together is added by Record from promRemoteWriteConfig.RunID.
+type txnLabels struct {
+	TxnType       string
+	WarehouseLow  int
+	WarehouseHigh int
+	Node          string
+}
+
+// Record enqueues one sample for each of latency (nanoseconds), an error
+// count (0 or 1), and, for New-Order transactions, a tpmC increment. Samples
+// are batched in memory and only sent to the remote-write endpoint by the
+// periodic flush loop started in Start.
+func (r *promReporter) Record(ts time.Time, l txnLabels, latencyNanos float64, isErr bool) {
+	if r == nil || r.cfg.URL == "" {
+		return
+	}
+
+	labels := []prompb.Label{
+		{Name: "__name__", Value: "tpcc_txn_latency_ns"},
+		{Name: "txn_type", Value: l.TxnType},
+		{Name: "warehouse_range", Value: warehouseRangeLabel(l.WarehouseLow, l.WarehouseHigh)},
+		{Name: "node", Value: l.Node},
+		{Name: "run_id", Value: r.cfg.RunID},
+	}
+	timestamp := ts.UnixNano() / int64(time.Millisecond)
+	sample := prompb.Sample{Value: latencyNanos, Timestamp: timestamp}
+
+	errLabels := make([]prompb.Label, len(labels))
+	copy(errLabels, labels)
+	errLabels[0].Value = "tpcc_txn_errors_total"
+	errSample := prompb.Sample{Timestamp: timestamp}
+	if isErr {
+		errSample.Value = 1
+	}
+
+	series := []prompb.TimeSeries{
+		{Labels: labels, Samples: []prompb.Sample{sample}},
+		{Labels: errLabels, Samples: []prompb.Sample{errSample}},
+	}
+	if l.TxnType == newOrderTxnType {
+		tpmcLabels := make([]prompb.Label, len(labels))
+		copy(tpmcLabels, labels)
+		tpmcLabels[0].Value = "tpcc_tpmc_total"
+		series = append(series, prompb.TimeSeries{
+			Labels:  tpmcLabels,
+			Samples: []prompb.Sample{{Value: 1, Timestamp: timestamp}},
+		})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mu.series = append(r.mu.series, series...)
+}
+
+func warehouseRangeLabel(low, high int) string {
+	buf := make([]byte, 0, 16)
+	buf = appendInt(buf, low)
+	buf = append(buf, '-')
+	buf = appendInt(buf, high)
+	return string(buf)
+}
+
+func appendInt(buf []byte, v int) []byte {
+	if v == 0 {
+		return append(buf, '0')
+	}
+	start := len(buf)
+	for v > 0 {
+		buf = append(buf, byte('0'+v%10))
+		v /= 10
+	}
+	for i, j := start, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	return buf
+}
+
+// Start runs the once-a-second flush loop until ctx is canceled.
+func (r *promReporter) Start(ctx context.Context) {
+	if r.cfg.URL == "" {
+		return
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.flush(ctx); err != nil {
+				// The remote-write endpoint being briefly unavailable
+				// shouldn't take down the benchmark; flush has already put
+				// the unsent batch back, so the next tick carries it forward.
+				continue
+			}
+		}
+	}
+}
+
+// flush snappy-compresses the accumulated series into a single
+// prompb.WriteRequest and POSTs it to the configured endpoint. On any
+// failure the batch is merged back into r.mu.series (ahead of whatever
+// Record has appended in the meantime) so a transient outage drops samples
+// from the graph's time axis, not from the data itself.
+func (r *promReporter) flush(ctx context.Context) error {
+	r.mu.Lock()
+	series := r.mu.series
+	r.mu.series = nil
+	r.mu.Unlock()
+
+	if len(series) == 0 {
+		return nil
+	}
+
+	if err := r.send(ctx, series); err != nil {
+		r.mu.Lock()
+		r.mu.series = append(series, r.mu.series...)
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// send POSTs series to the configured remote-write endpoint.
+func (r *promReporter) send(ctx context.Context, series []prompb.TimeSeries) error {
+	req := &prompb.WriteRequest{Timeseries: series}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "marshaling prometheus write request")
+	}
+	compressed := snappy.Encode(nil, data)
+
+	httpReq, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, r.cfg.URL, bytes.NewReader(compressed),
+	)
+	if err != nil {
+		return errors.Wrap(err, "constructing remote-write request")
+	}
+	httpReq.Header.Set("Content-Encoding", "snappy")
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	switch {
+	case r.cfg.BearerToken != "":
+		httpReq.Header.Set("Authorization", "Bearer "+r.cfg.BearerToken)
+	case r.cfg.BasicAuthUser != "":
+		httpReq.SetBasicAuth(r.cfg.BasicAuthUser, r.cfg.BasicAuthPass)
+	}
+
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		return errors.Wrap(err, "sending remote-write request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("remote-write endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package tpcc
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/spf13/pflag"
+)
+
+func mustReadAll(t *testing.T, r *http.Request) []byte {
+	t.Helper()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestPromRemoteWriteConfigFlags(t *testing.T) {
+	var c promRemoteWriteConfig
+	f := pflag.NewFlagSet(``, pflag.ContinueOnError)
+	c.flags(f)
+	if err := f.Parse([]string{`--prom-remote-write=http://localhost:9090/api/v1/write`, `--run-id=run1`}); err != nil {
+		t.Fatal(err)
+	}
+	if c.URL != `http://localhost:9090/api/v1/write` || c.RunID != `run1` {
+		t.Fatalf(`unexpected config after parsing flags: %+v`, c)
+	}
+}
+
+func TestPromReporterFlush(t *testing.T) {
+	var gotHeader http.Header
+	var gotSeries []prompb.TimeSeries
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		body, err := snappy.Decode(nil, mustReadAll(t, r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var req prompb.WriteRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			t.Fatal(err)
+		}
+		gotSeries = req.Timeseries
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	r := newPromReporter(promRemoteWriteConfig{URL: srv.URL, RunID: `run1`})
+	r.Record(time.Unix(0, 0), txnLabels{TxnType: newOrderTxnType, WarehouseLow: 1, WarehouseHigh: 10, Node: `n1`}, 1234, false)
+
+	if err := r.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := gotHeader.Get(`Content-Encoding`); got != `snappy` {
+		t.Fatalf(`got Content-Encoding %q`, got)
+	}
+	if got := gotHeader.Get(`X-Prometheus-Remote-Write-Version`); got != `0.1.0` {
+		t.Fatalf(`got X-Prometheus-Remote-Write-Version %q`, got)
+	}
+
+	var sawTPMC bool
+	for _, series := range gotSeries {
+		for _, l := range series.Labels {
+			if l.Name == `__name__` && l.Value == `tpcc_tpmc_total` {
+				sawTPMC = true
+			}
+		}
+	}
+	if !sawTPMC {
+		t.Fatal(`expected a tpcc_tpmc_total series for a newOrder transaction`)
+	}
+}
+
+func TestPromReporterFlushKeepsBatchOnError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	r := newPromReporter(promRemoteWriteConfig{URL: srv.URL})
+	r.Record(time.Unix(0, 0), txnLabels{TxnType: newOrderTxnType}, 1234, false)
+
+	if err := r.flush(context.Background()); err == nil {
+		t.Fatal(`expected an error from the 503 response`)
+	}
+
+	r.mu.Lock()
+	pending := len(r.mu.series)
+	r.mu.Unlock()
+	if pending == 0 {
+		t.Fatal(`expected the batch to be merged back into r.mu.series after a failed flush`)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package tpcc
+
+import (
+	"math/bits"
+
+	"github.com/spf13/pflag"
+	"golang.org/x/exp/rand"
+)
+
+type pcg32 struct {
+	state uint64
+}
+
+func newPCG32(seed uint64) *pcg32 {
+	pcg := &pcg32{}
+	pcg.Seed(seed)
+	return pcg
+}
+
+// Seed uses the provided seed value to initialize the generator to a deterministic state.
+func (pcg *pcg32) Seed(seed uint64) {
+	pcg.state = 0
+	pcg.Uint32()
+	pcg.state += seed
+	pcg.Uint32()
+}
+
+func (pcg *pcg32) Uint32() uint32 {
+	oldstate := pcg.state
+	pcg.state = oldstate*6364136223846793005 + 1
+	xorshifted := uint32(((oldstate >> 18) ^ oldstate) >> 27)
+	return bits.RotateLeft32(xorshifted, -int(oldstate>>59))
+}
+
+func uint8n(r uint8, n uint32) uint32 {
+	return (uint32(r) * n) >> 8
+}
+
+// Supported values for --rng.
+const (
+	rngKindPCG     = "pcg"
+	rngKindChaCha8 = "chacha8"
+)
+
+// rngConfig selects the RNG backend tpcc uses to fill fixed-width string
+// columns (C_DATA, ADDRESS, etc) during IMPORT/init, exposed as --rng.
+// chacha8 (see chacha.go) trades a larger keystream buffer for meaningfully
+// higher throughput than the default pcg-based generator on large imports.
+type rngConfig struct {
+	kind string
+}
+
+func (c *rngConfig) flags(f *pflag.FlagSet) {
+	f.StringVar(&c.kind, `rng`, rngKindPCG,
+		`RNG backend for string-column generation: pcg or chacha8`)
+}
+
+// source returns the rand.Source a worker with the given id should draw
+// from. seed is the workload's configured seed; workerID is mixed in as the
+// chacha8 nonce so that concurrent workers get independent, but still
+// deterministic, streams. The key is expanded from seed via
+// chachaKeyFromSeed (chacha.go), the same expansion chachaSource.Seed uses,
+// so --rng=chacha8 draws from the full 256 bits of key material rather than
+// seed alone zero-padded.
+func (c *rngConfig) source(seed uint64, workerID int) rand.Source {
+	if c.kind == rngKindChaCha8 {
+		return newChaChaSource(chachaKeyFromSeed(seed), uint64(workerID))
+	}
+	return rand.NewSource(seed)
+}
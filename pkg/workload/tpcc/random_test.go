@@ -17,38 +17,12 @@ package tpcc
 
 import (
 	"fmt"
-	"math/bits"
 	"testing"
 
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"golang.org/x/exp/rand"
 )
 
-type pcg32 struct {
-	state uint64
-}
-
-func newPCG32(seed uint64) *pcg32 {
-	pcg := &pcg32{}
-	pcg.Seed(seed)
-	return pcg
-}
-
-// Seed uses the provided seed value to initialize the generator to a deterministic state.
-func (pcg *pcg32) Seed(seed uint64) {
-	pcg.state = 0
-	pcg.Uint32()
-	pcg.state += seed
-	pcg.Uint32()
-}
-
-func (pcg *pcg32) Uint32() uint32 {
-	oldstate := pcg.state
-	pcg.state = oldstate*6364136223846793005 + 1
-	xorshifted := uint32(((oldstate >> 18) ^ oldstate) >> 27)
-	return bits.RotateLeft32(xorshifted, -int(oldstate>>59))
-}
-
 func TestPCG32(t *testing.T) {
 	rng := newPCG32(uint64(timeutil.Now().UnixNano()))
 	for i := 0; i < 100; i++ {
@@ -56,10 +30,6 @@ func TestPCG32(t *testing.T) {
 	}
 }
 
-func uint8n(r uint8, n uint32) uint32 {
-	return (uint32(r) * n) >> 8
-}
-
 func randStringLetters2(rng rand.Source, buf []byte) {
 	for len(buf) >= 8 {
 		r := rng.Uint64()
@@ -184,6 +154,15 @@ func BenchmarkRandStringFast(b *testing.B) {
 		}
 		b.SetBytes(strLen)
 	})
+	b.Run(`letters5`, func(b *testing.B) {
+		cfg := rngConfig{kind: rngKindChaCha8}
+		rng := cfg.source(uint64(timeutil.Now().UnixNano()), 0 /* workerID */).(*chachaSource)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			randStringLetters5(rng, buf)
+		}
+		b.SetBytes(strLen)
+	})
 	b.Run(`numbers`, func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
 			randStringNumbers(rng, buf)